@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChannelConfig holds the settings for a single notification channel.
+// Not every field applies to every channel; unused fields are left zero.
+type ChannelConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Template      string        `yaml:"template"`
+	GroupTemplate string        `yaml:"group_template"`
+	Timeout       time.Duration `yaml:"timeout"`
+
+	// Webhook is the destination URL for Slack, Discord, Teams and the
+	// generic webhook channel.
+	Webhook string `yaml:"webhook"`
+
+	// SMTP settings, used by the email channel only.
+	SMTPHost     string   `yaml:"smtp_host"`
+	SMTPPort     int      `yaml:"smtp_port"`
+	SMTPUsername string   `yaml:"smtp_username"`
+	SMTPPassword string   `yaml:"smtp_password"`
+	From         string   `yaml:"from"`
+	To           []string `yaml:"to"`
+}
+
+// ChannelsConfig lists every notifier the webhook knows how to build.
+type ChannelsConfig struct {
+	Telegram ChannelConfig `yaml:"telegram"`
+	Slack    ChannelConfig `yaml:"slack"`
+	Discord  ChannelConfig `yaml:"discord"`
+	Teams    ChannelConfig `yaml:"teams"`
+	Webhook  ChannelConfig `yaml:"webhook"`
+	Email    ChannelConfig `yaml:"email"`
+}
+
+const defaultNotifierTimeout = 5 * time.Second
+
+// loadChannelsConfig reads env.configFile if present. When the file is
+// missing we fall back to Telegram-only delivery so existing deployments
+// keep working without a config file.
+func loadChannelsConfig() ChannelsConfig {
+	cfg := ChannelsConfig{
+		Telegram: ChannelConfig{
+			Enabled:       true,
+			Template:      "telegram.tmpl",
+			GroupTemplate: "telegram-group.tmpl",
+			Timeout:       defaultNotifierTimeout,
+		},
+	}
+
+	data, err := os.ReadFile(env.configFile)
+	if err != nil {
+		slog.Warn("no channels config found, defaulting to Telegram-only", "config_file", env.configFile, "error", err)
+		return cfg
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		slog.Error("failed to parse channels config, cannot start", "config_file", env.configFile, "error", err)
+		os.Exit(1)
+	}
+
+	return cfg
+}
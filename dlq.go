@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// dlqKey is the Redis list of Telegram deliveries that exhausted their
+// retries, so they can be inspected and replayed instead of being dropped.
+const dlqKey = "dlq:telegram"
+
+// DLQEntry is one failed Telegram delivery.
+type DLQEntry struct {
+	ChatID    string    `json:"chat_id"`
+	Body      string    `json:"body"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// retryAfterDelay returns the delay Telegram's 429 response asked us to wait
+// before retrying, if err is (or wraps) a *bot.TooManyRequestsError. Its
+// RetryAfter field is a plain int of seconds, not a method, so it can't
+// satisfy an interface; a type-switch via errors.As is the only way to
+// recover it.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var tmr *bot.TooManyRequestsError
+	if !errors.As(err, &tmr) {
+		return 0, false
+	}
+	return time.Duration(tmr.RetryAfter) * time.Second, true
+}
+
+// sendWithRetry delivers body to chatID, retrying transient failures with
+// exponential backoff up to env.telegramMaxRetries attempts. If the error
+// from a failed attempt reports a Telegram Retry-After, that delay is
+// honored instead of the backoff. A delivery that never succeeds is pushed
+// onto dlq:telegram rather than silently dropped.
+func sendWithRetry(ctx context.Context, chatID, body string) (*models.Message, error) {
+	delay := env.telegramRetryBase
+	var lastErr error
+
+	for attempt := 1; attempt <= env.telegramMaxRetries; attempt++ {
+		sent, err := tbot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    chatID,
+			Text:      body,
+			ParseMode: models.ParseModeHTML,
+		})
+		if err == nil {
+			return sent, nil
+		}
+		lastErr = err
+
+		if attempt == env.telegramMaxRetries {
+			break
+		}
+
+		wait := delay
+		if rewait, ok := retryAfterDelay(err); ok {
+			wait = rewait
+		}
+
+		slog.Warn("telegram send failed, retrying", "chat_id", chatID, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			pushDLQ(context.WithoutCancel(ctx), chatID, body, attempt, err)
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+
+	pushDLQ(context.WithoutCancel(ctx), chatID, body, env.telegramMaxRetries, lastErr)
+	return nil, lastErr
+}
+
+// pushDLQ records a delivery that exhausted its retries.
+func pushDLQ(ctx context.Context, chatID, body string, attempts int, lastErr error) {
+	payload, err := json.Marshal(DLQEntry{
+		ChatID:    chatID,
+		Body:      body,
+		Attempts:  attempts,
+		LastError: lastErr.Error(),
+		FailedAt:  time.Now(),
+	})
+	if err != nil {
+		slog.Error("dlq marshal failed", "chat_id", chatID, "error", err)
+		return
+	}
+	if err := rclient.RPush(ctx, dlqKey, payload).Err(); err != nil {
+		slog.Error("dlq push failed", "chat_id", chatID, "error", err)
+	}
+}
+
+// listDLQ returns up to limit queued entries without removing them.
+func listDLQ(ctx context.Context, limit int64) ([]DLQEntry, error) {
+	raw, err := rclient.LRange(ctx, dlqKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]DLQEntry, 0, len(raw))
+	for _, r := range raw {
+		var entry DLQEntry
+		if err := json.Unmarshal([]byte(r), &entry); err != nil {
+			slog.Error("dlq decode failed", "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// purgeDLQ drops every queued entry.
+func purgeDLQ(ctx context.Context) error {
+	return rclient.Del(ctx, dlqKey).Err()
+}
+
+// replayDLQ pops every entry currently queued and retries delivery,
+// re-queuing any that fail again so a later replay can pick them back up.
+func replayDLQ(ctx context.Context) (replayed, failed int) {
+	queued, err := rclient.LLen(ctx, dlqKey).Result()
+	if err != nil {
+		slog.Error("dlq length failed", "error", err)
+		return replayed, failed
+	}
+
+	for i := int64(0); i < queued; i++ {
+		raw, err := rclient.LPop(ctx, dlqKey).Result()
+		if errors.Is(err, redis.Nil) {
+			return replayed, failed
+		}
+		if err != nil {
+			slog.Error("dlq pop failed", "error", err)
+			return replayed, failed
+		}
+
+		var entry DLQEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			slog.Error("dlq decode failed", "error", err)
+			continue
+		}
+
+		if _, err := tbot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    entry.ChatID,
+			Text:      entry.Body,
+			ParseMode: models.ParseModeHTML,
+		}); err != nil {
+			failed++
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.FailedAt = time.Now()
+			if payload, marshalErr := json.Marshal(entry); marshalErr == nil {
+				rclient.RPush(ctx, dlqKey, payload)
+			}
+			continue
+		}
+		replayed++
+	}
+	return replayed, failed
+}
+
+// dlqWorker periodically replays the DLQ so transient Telegram outages
+// drain on their own without operator intervention.
+func dlqWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			replayed, failed := replayDLQ(ctx)
+			if replayed > 0 || failed > 0 {
+				slog.Info("dlq worker replay", "replayed", replayed, "failed", failed)
+			}
+		}
+	}
+}
+
+// formatDLQStatus renders entries for the /dlq bot command.
+func formatDLQStatus(entries []DLQEntry) string {
+	if len(entries) == 0 {
+		return "DLQ is empty"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "showing %d queued entr(ies) (at most 20):\n", len(entries))
+	for _, e := range entries {
+		fmt.Fprintf(&b, "- %s (attempts=%d): %s\n", e.ChatID, e.Attempts, e.LastError)
+	}
+	return b.String()
+}
+
+func dlqListHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(mainContext, 2*time.Second)
+	defer cancel()
+
+	entries, err := listDLQ(ctx, 100)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(entries)
+}
+
+func dlqReplayHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(mainContext, 10*time.Second)
+	defer cancel()
+
+	replayed, failed := replayDLQ(ctx)
+	fmt.Fprintf(rw, "replayed %d, failed %d\n", replayed, failed)
+}
+
+func dlqPurgeHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(mainContext, 2*time.Second)
+	defer cancel()
+
+	if err := purgeDLQ(ctx); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// silencesKey is the Redis sorted set of active silence matchers, scored by
+// the Unix timestamp each one expires at, so expired matchers stop applying
+// without anyone having to sweep them out.
+const silencesKey = "silences"
+
+// pendingGroup buffers the firing/resolved alerts seen for one group key
+// between flushes. Alerts are keyed by fingerprint: a repeated resolved
+// notify for the same alert overwrites the earlier entry, while a repeated
+// firing notify within repeatInterval is dropped by isDuplicate.
+type pendingGroup struct {
+	mu       sync.Mutex
+	firing   map[string]MessageComposed
+	resolved map[string]MessageComposed
+	timer    *time.Timer
+}
+
+// Grouper coalesces incoming Alertmanager notifies sharing a group key into
+// a single outgoing message, waiting groupWait before the first flush and
+// groupInterval before subsequent ones, mirroring Alertmanager's own
+// group_wait/group_interval semantics on our side of the webhook.
+type Grouper struct {
+	mu     sync.Mutex
+	groups map[string]*pendingGroup
+}
+
+var grouper = &Grouper{groups: make(map[string]*pendingGroup)}
+
+// groupKeyFor returns msg's group key, falling back to one synthesized from
+// Source, Receiver and Status when Alertmanager didn't send an explicit
+// groupKey. Including Source keeps two tenants that share a receiver/status
+// from getting coalesced together.
+func groupKeyFor(msg Message) string {
+	if msg.GroupKey != "" {
+		return msg.GroupKey
+	}
+	return msg.Source + ":" + msg.Receiver + ":" + msg.Status
+}
+
+// Submit buffers msg's alerts under their group key and schedules a flush.
+func (g *Grouper) Submit(msg Message) {
+	groupKey := groupKeyFor(msg)
+
+	g.mu.Lock()
+	pg, exists := g.groups[groupKey]
+	if !exists {
+		pg = &pendingGroup{firing: make(map[string]MessageComposed), resolved: make(map[string]MessageComposed)}
+		g.groups[groupKey] = pg
+	}
+	g.mu.Unlock()
+
+	pg.mu.Lock()
+	for _, c := range msg.ComposeMessage() {
+		if silenced(c) {
+			continue
+		}
+		if c.Status == "resolved" {
+			delete(pg.firing, c.Fingerprint)
+			pg.resolved[c.Fingerprint] = c
+			continue
+		}
+		if isDuplicate(c.Fingerprint) {
+			continue
+		}
+		pg.firing[c.Fingerprint] = c
+	}
+
+	wait := env.groupInterval
+	if !exists {
+		wait = env.groupWait
+	}
+	if pg.timer == nil {
+		pg.timer = time.AfterFunc(wait, func() { g.flush(groupKey) })
+	}
+	pg.mu.Unlock()
+}
+
+func (g *Grouper) flush(groupKey string) {
+	g.mu.Lock()
+	pg, ok := g.groups[groupKey]
+	g.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	pg.mu.Lock()
+	grouped := GroupedAlerts{
+		GroupKey: groupKey,
+		Firing:   composedValues(pg.firing),
+		Resolved: composedValues(pg.resolved),
+	}
+	pg.firing = make(map[string]MessageComposed)
+	pg.resolved = make(map[string]MessageComposed)
+	pg.timer = nil
+	pg.mu.Unlock()
+
+	if len(grouped.Firing) == 0 && len(grouped.Resolved) == 0 {
+		return
+	}
+
+	dispatchGroup(grouped)
+}
+
+func composedValues(m map[string]MessageComposed) []MessageComposed {
+	res := make([]MessageComposed, 0, len(m))
+	for _, v := range m {
+		res = append(res, v)
+	}
+	return res
+}
+
+// dispatchGroup fans a coalesced group out to every enabled notifier
+// concurrently. Notifiers that understand groups get the combined message;
+// the rest fall back to one Send per alert.
+func dispatchGroup(grouped GroupedAlerts) {
+	var wg sync.WaitGroup
+
+	for _, notifier := range notifiers {
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(mainContext, notifier.Timeout())
+			defer cancel()
+
+			if err := sendGroupTo(ctx, notifier, grouped); err != nil {
+				log.Printf("%s: group delivery error: %v", notifier.Name(), err)
+			}
+		}(notifier)
+	}
+
+	wg.Wait()
+
+	for _, c := range grouped.Firing {
+		publishStreamEvent(grouped.GroupKey, c)
+	}
+	for _, c := range grouped.Resolved {
+		publishStreamEvent(grouped.GroupKey, c)
+	}
+}
+
+func sendGroupTo(ctx context.Context, notifier Notifier, grouped GroupedAlerts) error {
+	if gn, ok := notifier.(GroupNotifier); ok {
+		return gn.SendGroup(ctx, grouped)
+	}
+
+	var errs []error
+	for _, c := range grouped.Firing {
+		if err := notifier.Send(ctx, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, c := range grouped.Resolved {
+		if err := notifier.Send(ctx, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// isDuplicate reports whether fingerprint has already been notified within
+// repeatInterval, using a Redis key as the dedup marker.
+func isDuplicate(fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(mainContext, 2*time.Second)
+	defer cancel()
+
+	wasSet, err := rclient.SetNX(ctx, "dedup:"+fingerprint, 1, env.repeatInterval).Result()
+	if err != nil {
+		log.Printf("Dedup check failed for %s: %v", fingerprint, err)
+		return false
+	}
+	return !wasSet
+}
+
+// silenced reports whether any active, unexpired /silence matcher covers c.
+func silenced(c MessageComposed) bool {
+	ctx, cancel := context.WithTimeout(mainContext, 2*time.Second)
+	defer cancel()
+
+	matchers, err := rclient.ZRangeByScore(ctx, silencesKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(matchers) == 0 {
+		return false
+	}
+
+	for _, matcher := range matchers {
+		if matchesSilence(matcher, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSilence evaluates a "label=value" matcher, e.g. "severity=warning",
+// against c. Only the severity label is supported; a matcher on any other
+// label never matches, even though c.Labels holds the full label set.
+func matchesSilence(matcher string, c MessageComposed) bool {
+	label, value, ok := strings.Cut(matcher, "=")
+	if !ok {
+		return false
+	}
+
+	switch strings.TrimSpace(label) {
+	case "severity":
+		return strings.EqualFold(c.Severity, strings.TrimSpace(value))
+	default:
+		return false
+	}
+}
+
+// addSilence validates matcher and stores it scored to expire after ttl, so
+// a forgotten silence doesn't suppress alerts forever; /unsilence or expiry
+// are the only ways to remove one.
+func addSilence(ctx context.Context, matcher string, ttl time.Duration) error {
+	label, _, ok := strings.Cut(matcher, "=")
+	if !ok || strings.TrimSpace(label) == "" {
+		return fmt.Errorf("invalid matcher %q, expected label=value", matcher)
+	}
+	expiresAt := float64(time.Now().Add(ttl).Unix())
+	return rclient.ZAdd(ctx, silencesKey, redis.Z{Score: expiresAt, Member: matcher}).Err()
+}
+
+// removeSilence drops matcher from the silence set immediately, via
+// /unsilence, instead of waiting for it to expire.
+func removeSilence(ctx context.Context, matcher string) error {
+	return rclient.ZRem(ctx, silencesKey, matcher).Err()
+}
+
+// parseSilenceArgs splits a /silence command's argument into the matcher and
+// an optional trailing duration, e.g. "severity=critical 2h". With no
+// duration given, it falls back to env.silenceDefaultTTL.
+func parseSilenceArgs(arg string) (matcher string, ttl time.Duration, err error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return "", 0, fmt.Errorf("usage: /silence <label>=<value> [duration]")
+	}
+
+	ttl = env.silenceDefaultTTL
+	if len(fields) > 1 {
+		ttl, err = time.ParseDuration(fields[1])
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid duration %q: %w", fields[1], err)
+		}
+	}
+	return fields[0], ttl, nil
+}
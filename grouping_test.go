@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestGroupKeyFor(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{
+			name: "explicit groupKey wins",
+			msg:  Message{GroupKey: "am-group-1", Source: "prod", Receiver: "default", Status: "firing"},
+			want: "am-group-1",
+		},
+		{
+			name: "falls back to source:receiver:status",
+			msg:  Message{Source: "prod", Receiver: "default", Status: "firing"},
+			want: "prod:default:firing",
+		},
+		{
+			name: "different sources don't collide without an explicit groupKey",
+			msg:  Message{Source: "staging", Receiver: "default", Status: "firing"},
+			want: "staging:default:firing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupKeyFor(tt.msg); got != tt.want {
+				t.Errorf("groupKeyFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesSilence(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher string
+		alert   MessageComposed
+		want    bool
+	}{
+		{
+			name:    "matching severity",
+			matcher: "severity=warning",
+			alert:   MessageComposed{Severity: "warning"},
+			want:    true,
+		},
+		{
+			name:    "matching severity is case-insensitive",
+			matcher: "severity=Warning",
+			alert:   MessageComposed{Severity: "warning"},
+			want:    true,
+		},
+		{
+			name:    "non-matching severity",
+			matcher: "severity=critical",
+			alert:   MessageComposed{Severity: "warning"},
+			want:    false,
+		},
+		{
+			name:    "unsupported label always fails",
+			matcher: "source=prod",
+			alert:   MessageComposed{Source: "prod"},
+			want:    false,
+		},
+		{
+			name:    "malformed matcher without =",
+			matcher: "severity",
+			alert:   MessageComposed{Severity: "warning"},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesSilence(tt.matcher, tt.alert); got != tt.want {
+				t.Errorf("matchesSilence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamChannel is the Redis Pub/Sub channel every replica publishes
+// delivered alerts on, so /stream and /ws listeners get the same logical
+// feed no matter which replica they're connected to.
+const streamChannel = "alerts:stream"
+
+// streamListenerBuffer bounds how many unread events a slow /stream or /ws
+// client can fall behind before it gets dropped rather than blocking
+// delivery to everyone else.
+const streamListenerBuffer = 32
+
+// StreamEvent is what /stream and /ws deliver: one alert as it was
+// dispatched to Telegram, alongside the group it was coalesced under.
+type StreamEvent struct {
+	GroupKey string          `json:"groupKey"`
+	Alert    MessageComposed `json:"alert"`
+}
+
+// streamFilter is a listener's optional severity/source/label filter, parsed
+// from query params like ?severity=critical&source=prod&label.env=prod.
+type streamFilter struct {
+	severity string
+	source   string
+	labels   map[string]string
+}
+
+func parseStreamFilter(q url.Values) streamFilter {
+	f := streamFilter{severity: q.Get("severity"), source: q.Get("source"), labels: make(map[string]string)}
+	for key, vals := range q {
+		name, ok := strings.CutPrefix(key, "label.")
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		f.labels[name] = vals[0]
+	}
+	return f
+}
+
+func (f streamFilter) Matches(ev StreamEvent) bool {
+	if f.severity != "" && !strings.EqualFold(ev.Alert.Severity, f.severity) {
+		return false
+	}
+	if f.source != "" && !strings.EqualFold(ev.Alert.Source, f.source) {
+		return false
+	}
+	for name, want := range f.labels {
+		if !strings.EqualFold(ev.Alert.Labels[name], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hub fans out StreamEvents to this replica's /stream and /ws clients.
+// Events only ever reach it through the Redis Pub/Sub bridge (see
+// subscribeStream), so every replica's hub sees the same feed.
+type Hub struct {
+	mu        sync.Mutex
+	listeners map[chan StreamEvent]streamFilter
+}
+
+var streamHub = &Hub{listeners: make(map[chan StreamEvent]streamFilter)}
+
+// Subscribe registers a new listener matching filter and returns its event
+// channel plus an unsubscribe func the caller must run on disconnect.
+func (h *Hub) Subscribe(filter streamFilter) (<-chan StreamEvent, func()) {
+	ch := make(chan StreamEvent, streamListenerBuffer)
+
+	h.mu.Lock()
+	h.listeners[ch] = filter
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		delete(h.listeners, ch)
+		h.mu.Unlock()
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// broadcastLocal fans ev out to this replica's own listeners only; it never
+// touches Redis.
+func (h *Hub) broadcastLocal(ev StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch, filter := range h.listeners {
+		if !filter.Matches(ev) {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("stream listener too slow, dropping event for group %s", ev.GroupKey)
+		}
+	}
+}
+
+// publishStreamEvent hands the alert to Redis so every replica's
+// subscribeStream goroutine, including this one, fans it out to its local
+// /stream and /ws clients.
+func publishStreamEvent(groupKey string, alert MessageComposed) {
+	payload, err := json.Marshal(StreamEvent{GroupKey: groupKey, Alert: alert})
+	if err != nil {
+		log.Printf("stream event marshal failed: %v", err)
+		return
+	}
+	if err := rclient.Publish(mainContext, streamChannel, payload).Err(); err != nil {
+		log.Printf("stream event publish failed: %v", err)
+	}
+}
+
+// subscribeStream runs for the process lifetime, relaying every event
+// published on streamChannel by any replica to this replica's local hub.
+func subscribeStream() {
+	sub := rclient.Subscribe(mainContext, streamChannel)
+	for msg := range sub.Channel() {
+		var ev StreamEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			log.Printf("stream event decode failed: %v", err)
+			continue
+		}
+		streamHub.broadcastLocal(ev)
+	}
+}
+
+// authenticateStream validates the caller's ?token= for /stream and /ws and
+// returns the filter they're allowed to use. A token matching
+// ADMIN_API_TOKEN sees every source; otherwise the token must match the
+// signing secret of the single source named in ?source=, and the caller is
+// locked to that source regardless of any other filter it sent.
+func authenticateStream(ctx context.Context, req *http.Request) (streamFilter, bool) {
+	filter := parseStreamFilter(req.URL.Query())
+
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		return streamFilter{}, false
+	}
+	if env.adminAPIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(env.adminAPIToken)) == 1 {
+		return filter, true
+	}
+
+	if filter.source == "" {
+		return streamFilter{}, false
+	}
+	secret, ok, err := sourceSecret(ctx, filter.source)
+	if err != nil || !ok {
+		return streamFilter{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return streamFilter{}, false
+	}
+	return filter, true
+}
+
+// streamHandler serves GET /stream, a Server-Sent Events feed of delivered
+// alerts filtered by the same query params as /ws.
+func streamHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	filter, ok := authenticateStream(ctx, req)
+	cancel()
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := streamHub.Subscribe(filter)
+	defer unsubscribe()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(rw, "data: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(req *http.Request) bool { return true },
+}
+
+// wsHandler serves GET /ws, upgrading to a WebSocket that streams the same
+// filtered alert feed as /stream.
+func wsHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), 2*time.Second)
+	filter, ok := authenticateStream(ctx, req)
+	cancel()
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		log.Printf("ws upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := streamHub.Subscribe(filter)
+	defer unsubscribe()
+
+	for ev := range events {
+		if err := conn.WriteJSON(ev); err != nil {
+			return
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"iter"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/go-telegram/bot"
@@ -21,29 +25,51 @@ import (
 )
 
 type Environment struct {
-	botToken     string
-	serverHost   string
-	serverPort   string
-	dbURI        string
-	dbUsername   string
-	dbPassword   string
-	templatesDir string
+	botToken           string
+	serverHost         string
+	serverPort         string
+	dbURI              string
+	dbUsername         string
+	dbPassword         string
+	templatesDir       string
+	configFile         string
+	groupWait          time.Duration
+	groupInterval      time.Duration
+	repeatInterval     time.Duration
+	adminChatIDs       []string
+	adminAPIToken      string
+	telegramMaxRetries int
+	telegramRetryBase  time.Duration
+	dlqReplayInterval  time.Duration
+	silenceDefaultTTL  time.Duration
 }
 
 var env Environment = Environment{
-	botToken:     getEnv("BOT_TOKEN", "token"),
-	serverHost:   getEnv("SERVER_HOST", "0.0.0.0"),
-	serverPort:   getEnv("SERVER_PORT", "8080"),
-	dbURI:        getEnv("DB_URI", "127.0.0.1:6379"),
-	dbUsername:   getEnv("DB_USERNAME", ""),
-	dbPassword:   getEnv("DB_PASSWORD", ""),
-	templatesDir: getEnv("TEMPLATES_DIR", "./templates"),
+	botToken:           getEnv("BOT_TOKEN", "token"),
+	serverHost:         getEnv("SERVER_HOST", "0.0.0.0"),
+	serverPort:         getEnv("SERVER_PORT", "8080"),
+	dbURI:              getEnv("DB_URI", "127.0.0.1:6379"),
+	dbUsername:         getEnv("DB_USERNAME", ""),
+	dbPassword:         getEnv("DB_PASSWORD", ""),
+	templatesDir:       getEnv("TEMPLATES_DIR", "./templates"),
+	configFile:         getEnv("CONFIG_FILE", "./channels.yaml"),
+	groupWait:          getEnvDuration("GROUP_WAIT", 30*time.Second),
+	groupInterval:      getEnvDuration("GROUP_INTERVAL", 5*time.Minute),
+	repeatInterval:     getEnvDuration("REPEAT_INTERVAL", 4*time.Hour),
+	adminChatIDs:       getEnvList("ADMIN_CHAT_IDS", nil),
+	adminAPIToken:      getEnv("ADMIN_API_TOKEN", ""),
+	telegramMaxRetries: getEnvInt("TELEGRAM_MAX_RETRIES", 3),
+	telegramRetryBase:  getEnvDuration("TELEGRAM_RETRY_BASE", 500*time.Millisecond),
+	dlqReplayInterval:  getEnvDuration("DLQ_REPLAY_INTERVAL", 5*time.Minute),
+	silenceDefaultTTL:  getEnvDuration("SILENCE_DEFAULT_TTL", 24*time.Hour),
 }
 
 var rclient *redis.Client
 var mainContext context.Context
 var tbot *bot.Bot
 var templates *template.Template
+var textTemplates *texttemplate.Template
+var notifiers []Notifier
 
 func getEnv(envVar string, fallback string) string {
 	if env := os.Getenv(envVar); env != "" {
@@ -52,14 +78,88 @@ func getEnv(envVar string, fallback string) string {
 	return fallback
 }
 
+func getEnvDuration(envVar string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(envVar)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using default %s: %v", envVar, raw, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func getEnvList(envVar string, fallback []string) []string {
+	raw := os.Getenv(envVar)
+	if raw == "" {
+		return fallback
+	}
+	return strings.Split(raw, ",")
+}
+
+func getEnvInt(envVar string, fallback int) int {
+	raw := os.Getenv(envVar)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid int for %s=%q, using default %d: %v", envVar, raw, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+// isAdmin reports whether chatID is allowed to run admin-only bot commands
+// (/newsource, /revoke, ...), as configured via ADMIN_CHAT_IDS.
+func isAdmin(chatID string) bool {
+	return slices.Contains(env.adminChatIDs, chatID)
+}
+
+// requireAdminToken wraps an admin-only HTTP handler (the /dlq/* endpoints)
+// so it only runs when the request's X-Admin-Token header matches
+// ADMIN_API_TOKEN. With no token configured, access is denied rather than
+// left open.
+func requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		given := req.Header.Get("X-Admin-Token")
+		if env.adminAPIToken == "" || subtle.ConstantTimeCompare([]byte(given), []byte(env.adminAPIToken)) != 1 {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(rw, req)
+	}
+}
+
 type Alert struct {
+	Status       string      `json:"status"`
 	Labels       Labels      `json:"labels"`
 	Annotations  Annotations `json:"annotations"`
+	StartsAt     time.Time   `json:"startsAt"`
+	EndsAt       time.Time   `json:"endsAt"`
 	GeneratorURL string      `json:"generatorURL"`
+	Fingerprint  string      `json:"fingerprint"`
 }
 
+// Labels holds an alert's full label set. Severity is pulled out into its
+// own field since callers match on it constantly, but the rest of the
+// labels (env, instance, job, ...) survive in All for consumers like the
+// /stream and /ws label.* filters that need arbitrary keys.
 type Labels struct {
-	Severity string `json:"severity"`
+	Severity string
+	All      map[string]string
+}
+
+func (l *Labels) UnmarshalJSON(data []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	l.Severity = raw["severity"]
+	l.All = raw
+	return nil
 }
 
 type Annotations struct {
@@ -73,9 +173,23 @@ var severity map[string]string = map[string]string{
 	"critical": "⛔",
 }
 
+// Message is the Alertmanager v4 webhook payload. Alertmanager sends one of
+// these per notify, with Alerts already grouped by GroupLabels upstream;
+// GroupKey identifies that grouping so repeated notifies for the same group
+// can be coalesced again on our side.
 type Message struct {
-	Alerts []Alert `json:"alerts"`
-	Status string  `json:"status"`
+	Receiver          string            `json:"receiver"`
+	Status            string            `json:"status"`
+	Alerts            []Alert           `json:"alerts"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	GroupKey          string            `json:"groupKey"`
+
+	// Source is the {source} path segment ingestHandler authenticated this
+	// message under. It's never present in the Alertmanager payload itself.
+	Source string `json:"-"`
 }
 
 type MessageComposed struct {
@@ -85,20 +199,9 @@ type MessageComposed struct {
 	Summary      string
 	Description  string
 	GeneratorURL string
-}
-
-func (msg *Message) Format() string {
-
-	result := ""
-
-	for _, alert := range msg.Alerts {
-		var header string = alert.Labels.Severity
-		if value, ok := severity[alert.Labels.Severity]; ok {
-			header = fmt.Sprintf("%s <b>%s</b> %s", value, cases.Title(language.English, cases.Compact).String(alert.Labels.Severity), value)
-		}
-		result += fmt.Sprintf("%s\nMessage: <blockquote>%s</blockquote>\n---\n<blockquote>%s</blockquote>\n<a href=\"%s\">Metric that caused alert</a>", header, alert.Annotations.Summary, alert.Annotations.Description, alert.GeneratorURL)
-	}
-	return result
+	Fingerprint  string
+	Labels       map[string]string
+	Source       string
 }
 
 func (msg *Message) ComposeMessage() []MessageComposed {
@@ -111,15 +214,25 @@ func (msg *Message) ComposeMessage() []MessageComposed {
 		res = append(res, MessageComposed{
 			Severity:     cases.Title(language.English, cases.Compact).String(alert.Labels.Severity),
 			SeverityIcon: icon,
-			Status:       msg.Status,
+			Status:       alert.Status,
 			Summary:      alert.Annotations.Summary,
 			Description:  alert.Annotations.Description,
 			GeneratorURL: alert.GeneratorURL,
+			Fingerprint:  alert.Fingerprint,
+			Labels:       alert.Labels.All,
+			Source:       msg.Source,
 		})
 	}
 	return res
 }
 
+// loadTemplates parses every file in env.templatesDir twice: once as
+// html/template, for channels that send HTML (Telegram's ParseModeHTML,
+// Email's text/html body), and once as text/template, for channels whose
+// payload is JSON (Slack, Discord, Teams, the generic webhook). html/template
+// would HTML-escape "&", "<", ">" and "\"" inside JSON string fields,
+// corrupting the payload, so those channels must render through the
+// non-escaping set instead.
 func loadTemplates() {
 	files, _ := os.ReadDir(env.templatesDir)
 
@@ -134,24 +247,14 @@ func loadTemplates() {
 	var err error
 	templates, err = template.ParseFiles(filesNames...)
 	if err != nil {
-		log.Panic(err.Error())
+		slog.Error("failed to load templates, cannot start", "templates_dir", env.templatesDir, "error", err)
+		os.Exit(1)
 	}
-}
 
-func (msg *Message) AllAlerts() iter.Seq[string] {
-	compMsgs := msg.ComposeMessage()
-	return func(yield func(string) bool) {
-		for _, compMsg := range compMsgs {
-			var buf bytes.Buffer
-			err := templates.ExecuteTemplate(&buf, "message-template", compMsg)
-			if err != nil {
-				log.Panic(err.Error())
-			}
-
-			if !yield(buf.String()) {
-				return
-			}
-		}
+	textTemplates, err = texttemplate.ParseFiles(filesNames...)
+	if err != nil {
+		slog.Error("failed to load templates, cannot start", "templates_dir", env.templatesDir, "error", err)
+		os.Exit(1)
 	}
 }
 
@@ -159,6 +262,10 @@ func init() {
 	loadTemplates()
 }
 
+func init() {
+	notifiers = buildNotifiers(loadChannelsConfig())
+}
+
 func init() {
 	mainContext = context.Background()
 	ctx, cancel := context.WithTimeout(mainContext, time.Second*5)
@@ -194,43 +301,84 @@ func init() {
 
 }
 
-func mainHandler(rw http.ResponseWriter, req *http.Request) {
-	path := req.RequestURI
-	log.Printf("Action %s to %s from %s", req.Method, path, req.RemoteAddr)
+// defaultSourceName is the source mainHandler authenticates against. It
+// must be minted with "/newsource default" like any other source before
+// POST / will accept anything; there is no unauthenticated path left.
+const defaultSourceName = "default"
 
+// mainHandler serves the original, unscoped POST /. It now shares
+// ingestAlert with ingestHandler, so it requires the same HMAC signature
+// as every other source, just against the fixed name "default" instead of
+// one taken from the path. This closes what used to be an unauthenticated
+// bypass of the per-source signing added alongside /ingest/{source}.
+func mainHandler(rw http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	ingestAlert(rw, req, defaultSourceName)
+}
 
-	var msg Message
+// ingestHandler serves POST /ingest/{source}, the per-source alternative to
+// mainHandler. It also scopes the alert to source so /subscribe <source>
+// and the per-source rate limit apply.
+func ingestHandler(rw http.ResponseWriter, req *http.Request) {
+	ingestAlert(rw, req, req.PathValue("source"))
+}
 
-	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
-		log.Panic(err.Error())
+// ingestAlert is the shared body of mainHandler and ingestHandler: every
+// source, including "default", has its own HMAC secret minted with
+// /newsource, and requests must carry a matching X-Signature header
+// (Alertmanager's --web.config.file signing scheme) before anything is
+// parsed.
+func ingestAlert(rw http.ResponseWriter, req *http.Request, source string) {
+	ctx, cancel := context.WithTimeout(mainContext, 2*time.Second)
+	defer cancel()
+
+	secret, ok, err := sourceSecret(ctx, source)
+	if err != nil {
+		slog.Error("source lookup failed", "source", source, "error", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
-	log.Printf("Recieved message:\n%v", msg)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(mainContext, time.Second*2)
-	defer cancel()
+	if !verifySignature(secret, body, req.Header.Get("X-Signature")) {
+		slog.Warn("rejected unsigned or mis-signed ingest", "source", source, "remote_addr", req.RemoteAddr)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 
-	subscribers, err := rclient.LRange(ctx, "subscribers", 0, -1).Result()
+	allowed, err := allowSource(ctx, source)
 	if err != nil {
-		log.Panic(err.Error())
+		slog.Error("rate limit check failed", "source", source, "error", err)
+	} else if !allowed {
+		rw.WriteHeader(http.StatusTooManyRequests)
+		return
 	}
 
-	for alert := range msg.AllAlerts() {
-		for _, subscriber := range subscribers {
-			if _, err := tbot.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:    subscriber,
-				Text:      alert,
-				ParseMode: models.ParseModeHTML,
-			}); err != nil {
-				rw.WriteHeader(http.StatusInternalServerError)
-				log.Panic(err.Error())
-			}
-		}
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		slog.Error("invalid alert payload", "source", source, "error", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
 	}
+	msg.Source = source
+
+	log.Printf("Action %s to %s from %s (source=%s)", req.Method, req.RequestURI, req.RemoteAddr, source)
+
+	// Submit only buffers the alert for grouping; respond as soon as it's
+	// validated and enqueued rather than waiting for delivery.
+	grouper.Submit(msg)
 
 	rw.WriteHeader(http.StatusOK)
 }
@@ -242,18 +390,107 @@ func botHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 
 	var response string
 
-	switch update.Message.Text {
+	chatID := fmt.Sprint(update.Message.Chat.ID)
+	command, arg, _ := strings.Cut(update.Message.Text, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
 	case "/unsubscribe":
-		rclient.LRem(resdisctx, "subscribers", 0, update.Message.Chat.ID)
-		response = "Succesfully unsubscribed"
+		if err := unsubscribeChat(resdisctx, chatID); err != nil {
+			response = fmt.Sprintf("Could not unsubscribe: %s", err.Error())
+		} else {
+			response = "Succesfully unsubscribed"
+		}
 	case "/subscribe":
-		subscribers, err := rclient.LRange(resdisctx, "subscribers", 0, -1).Result()
-		if !slices.Contains(subscribers, fmt.Sprint(update.Message.Chat.ID)) || err != nil {
-			rclient.RPush(resdisctx, "subscribers", update.Message.Chat.ID)
+		if err := subscribeChat(resdisctx, chatID, arg); err != nil {
+			response = fmt.Sprintf("Could not subscribe: %s", err.Error())
+		} else if arg == "" {
+			response = "Succesfully subscribed"
+		} else {
+			response = fmt.Sprintf("Succesfully subscribed to source %q", arg)
+		}
+	case "/silence":
+		if !isAdmin(chatID) {
+			response = "Not authorized"
+		} else if matcher, ttl, err := parseSilenceArgs(arg); err != nil {
+			response = err.Error()
+		} else if err := addSilence(resdisctx, matcher, ttl); err != nil {
+			response = fmt.Sprintf("Could not add silence: %s", err.Error())
+		} else {
+			response = fmt.Sprintf("Silenced alerts matching %q for %s", matcher, ttl)
+		}
+	case "/unsilence":
+		if !isAdmin(chatID) {
+			response = "Not authorized"
+		} else if arg == "" {
+			response = "Usage: /unsilence <label>=<value>"
+		} else if err := removeSilence(resdisctx, arg); err != nil {
+			response = fmt.Sprintf("Could not remove silence: %s", err.Error())
+		} else {
+			response = fmt.Sprintf("Removed silence %q", arg)
+		}
+	case "/filter":
+		if err := setFilter(resdisctx, chatID, arg); err != nil {
+			response = err.Error()
+		} else {
+			response = fmt.Sprintf("Filter set: %s", arg)
+		}
+	case "/mute":
+		if err := setMute(resdisctx, chatID, arg); err != nil {
+			response = err.Error()
+		} else {
+			response = fmt.Sprintf("Muted: %s", arg)
+		}
+	case "/route":
+		if err := setRoute(resdisctx, chatID, arg); err != nil {
+			response = err.Error()
+		} else {
+			response = fmt.Sprintf("Route set: %s", arg)
+		}
+	case "/status":
+		if status, err := statusFor(resdisctx, chatID); err != nil {
+			response = fmt.Sprintf("Could not load status: %s", err.Error())
+		} else {
+			response = status
+		}
+	case "/test":
+		if tn := telegramNotifier(); tn == nil {
+			response = "Telegram notifier is not enabled"
+		} else if err := tn.SendTest(resdisctx, chatID); err != nil {
+			response = fmt.Sprintf("Could not send test alert: %s", err.Error())
+		} else {
+			return
+		}
+	case "/newsource":
+		if !isAdmin(chatID) {
+			response = "Not authorized"
+		} else if arg == "" {
+			response = "Usage: /newsource <name>"
+		} else if token, err := newSource(resdisctx, arg); err != nil {
+			response = fmt.Sprintf("Could not create source: %s", err.Error())
+		} else {
+			response = fmt.Sprintf("Source %q created.\nToken: %s\nSign requests with X-Signature: sha256=HMAC_SHA256(token, body)", arg, token)
+		}
+	case "/revoke":
+		if !isAdmin(chatID) {
+			response = "Not authorized"
+		} else if arg == "" {
+			response = "Usage: /revoke <name>"
+		} else if err := revokeSource(resdisctx, arg); err != nil {
+			response = fmt.Sprintf("Could not revoke source: %s", err.Error())
+		} else {
+			response = fmt.Sprintf("Source %q revoked", arg)
+		}
+	case "/dlq":
+		if !isAdmin(chatID) {
+			response = "Not authorized"
+		} else if entries, err := listDLQ(resdisctx, 20); err != nil {
+			response = fmt.Sprintf("Could not load DLQ: %s", err.Error())
+		} else {
+			response = formatDLQStatus(entries)
 		}
-		response = "Succesfully subscribed"
 	default:
-		response = "Unknown command.\nUse /subscribe or /unsubscribe"
+		response = "Unknown command.\nUse /subscribe [source], /unsubscribe, /filter, /mute, /route, /status, /silence, /unsilence, /test or /dlq"
 	}
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
@@ -264,6 +501,15 @@ func botHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 
 func main() {
 	http.HandleFunc("/", mainHandler)
+	http.HandleFunc("POST /ingest/{source}", ingestHandler)
+	http.HandleFunc("/stream", streamHandler)
+	http.HandleFunc("/ws", wsHandler)
+	http.HandleFunc("/dlq/list", requireAdminToken(dlqListHandler))
+	http.HandleFunc("POST /dlq/replay", requireAdminToken(dlqReplayHandler))
+	http.HandleFunc("POST /dlq/purge", requireAdminToken(dlqPurgeHandler))
+
+	go dlqWorker(mainContext, env.dlqReplayInterval)
+	go subscribeStream()
 
 	log.Printf("Runnging go server on %s:%s \n", env.serverHost, env.serverPort)
 	log.Printf("Redis on %s\n", env.dbURI)
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Notifier delivers a single composed alert to one channel.
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, msg MessageComposed) error
+	// Timeout bounds how long the caller should let Send run.
+	Timeout() time.Duration
+}
+
+// GroupNotifier is implemented by notifiers that can coalesce a whole
+// alert group into one message instead of one message per alert.
+// Notifiers that don't implement it fall back to per-alert Send calls.
+type GroupNotifier interface {
+	Notifier
+	SendGroup(ctx context.Context, group GroupedAlerts) error
+}
+
+// GroupedAlerts is the firing/resolved set buffered for a single
+// Alertmanager group key, ready to render as one message.
+type GroupedAlerts struct {
+	GroupKey string
+	Firing   []MessageComposed
+	Resolved []MessageComposed
+}
+
+// render executes templateName against data through the html/template set,
+// producing the body for channels whose payload is HTML (Telegram,
+// EmailNotifier).
+func render(templateName string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, templateName, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderText executes templateName against data through the text/template
+// set, for channels whose payload is JSON (webhookNotifier). html/template
+// would HTML-escape "&", "<", ">" and "\"" inside string fields and corrupt
+// the JSON body, so these channels must not go through render.
+func renderText(templateName string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&buf, templateName, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// TelegramNotifier fans the alert out to every subscribed chat.
+type TelegramNotifier struct {
+	template      string
+	groupTemplate string
+	timeout       time.Duration
+}
+
+func (n *TelegramNotifier) Name() string           { return "telegram" }
+func (n *TelegramNotifier) Timeout() time.Duration { return n.timeout }
+
+func (n *TelegramNotifier) Send(ctx context.Context, msg MessageComposed) error {
+	body, err := render(n.template, msg)
+	if err != nil {
+		return err
+	}
+
+	subscribers, err := rclient.SMembers(ctx, "subscribers").Result()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, subscriber := range subscribers {
+		rules, err := loadSubscriberRules(ctx, subscriber)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", subscriber, err))
+			continue
+		}
+		if rules.Muted(time.Now()) || !rules.Matches(msg) {
+			continue
+		}
+
+		if _, err := sendWithRetry(ctx, subscriber, body); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", subscriber, err))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// SendGroup renders the whole group as one message per subscriber. If a
+// message was already sent for this group key to a given chat, it edits
+// that message in place instead of posting a new one, so repeated
+// notifies and resolutions update the original rather than spamming the
+// chat.
+func (n *TelegramNotifier) SendGroup(ctx context.Context, group GroupedAlerts) error {
+	subscribers, err := rclient.SMembers(ctx, "subscribers").Result()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, subscriber := range subscribers {
+		rules, err := loadSubscriberRules(ctx, subscriber)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", subscriber, err))
+			continue
+		}
+		if rules.Muted(time.Now()) {
+			continue
+		}
+
+		filtered := filterGroup(group, rules)
+		if len(filtered.Firing) == 0 && len(filtered.Resolved) == 0 {
+			continue
+		}
+
+		body, err := render(n.groupTemplate, filtered)
+		if err != nil {
+			return err
+		}
+
+		if err := n.sendOrUpdate(ctx, subscriber, group.GroupKey, body); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", subscriber, err))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// filterGroup keeps only the alerts in group that match rules.
+func filterGroup(group GroupedAlerts, rules SubscriberRules) GroupedAlerts {
+	filtered := GroupedAlerts{GroupKey: group.GroupKey}
+	for _, c := range group.Firing {
+		if rules.Matches(c) {
+			filtered.Firing = append(filtered.Firing, c)
+		}
+	}
+	for _, c := range group.Resolved {
+		if rules.Matches(c) {
+			filtered.Resolved = append(filtered.Resolved, c)
+		}
+	}
+	return filtered
+}
+
+func (n *TelegramNotifier) sendOrUpdate(ctx context.Context, chatID, groupKey, body string) error {
+	cacheKey := fmt.Sprintf("grpmsg:%s:%s", groupKey, chatID)
+
+	if cached, err := rclient.Get(ctx, cacheKey).Result(); err == nil && cached != "" {
+		if _, err := tbot.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: mustAtoi(cached),
+			Text:      body,
+			ParseMode: models.ParseModeHTML,
+		}); err == nil {
+			return nil
+		}
+		// The original message may have been deleted or aged out of
+		// Telegram's edit window; fall back to sending a fresh one below.
+	}
+
+	sent, err := sendWithRetry(ctx, chatID, body)
+	if err != nil {
+		return err
+	}
+
+	rclient.Set(ctx, cacheKey, sent.ID, env.repeatInterval)
+	return nil
+}
+
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// SendTest delivers sampleAlert straight to chatID, bypassing every
+// subscriber filter, so /test always produces a visible message.
+func (n *TelegramNotifier) SendTest(ctx context.Context, chatID string) error {
+	body, err := render(n.template, sampleAlert)
+	if err != nil {
+		return err
+	}
+	_, err = tbot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      body,
+		ParseMode: models.ParseModeHTML,
+	})
+	return err
+}
+
+// telegramNotifier finds the configured Telegram notifier, if any.
+func telegramNotifier() *TelegramNotifier {
+	for _, n := range notifiers {
+		if tn, ok := n.(*TelegramNotifier); ok {
+			return tn
+		}
+	}
+	return nil
+}
+
+// webhookNotifier POSTs the rendered template body to a fixed URL. It backs
+// Slack incoming webhooks, Discord webhooks, Teams connectors, and the
+// generic webhook channel, which only differ in how their template renders
+// the JSON payload.
+type webhookNotifier struct {
+	name    string
+	url     string
+	tmpl    string
+	timeout time.Duration
+}
+
+func (n *webhookNotifier) Name() string           { return n.name }
+func (n *webhookNotifier) Timeout() time.Duration { return n.timeout }
+
+func (n *webhookNotifier) Send(ctx context.Context, msg MessageComposed) error {
+	body, err := renderText(n.tmpl, msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %s", n.name, resp.Status)
+	}
+	return nil
+}
+
+func newSlackNotifier(cfg ChannelConfig) Notifier {
+	return &webhookNotifier{name: "slack", url: cfg.Webhook, tmpl: cfg.Template, timeout: notifierTimeout(cfg)}
+}
+
+func newDiscordNotifier(cfg ChannelConfig) Notifier {
+	return &webhookNotifier{name: "discord", url: cfg.Webhook, tmpl: cfg.Template, timeout: notifierTimeout(cfg)}
+}
+
+func newTeamsNotifier(cfg ChannelConfig) Notifier {
+	return &webhookNotifier{name: "teams", url: cfg.Webhook, tmpl: cfg.Template, timeout: notifierTimeout(cfg)}
+}
+
+func newGenericWebhookNotifier(cfg ChannelConfig) Notifier {
+	return &webhookNotifier{name: "webhook", url: cfg.Webhook, tmpl: cfg.Template, timeout: notifierTimeout(cfg)}
+}
+
+// EmailNotifier sends the rendered template body as an email body over SMTP.
+type EmailNotifier struct {
+	cfg     ChannelConfig
+	timeout time.Duration
+}
+
+func (n *EmailNotifier) Name() string           { return "email" }
+func (n *EmailNotifier) Timeout() time.Duration { return n.timeout }
+
+func (n *EmailNotifier) Send(ctx context.Context, msg MessageComposed) error {
+	body, err := render(n.cfg.Template, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", n.cfg.SMTPHost, n.cfg.SMTPPort)
+	auth := smtp.PlainAuth("", n.cfg.SMTPUsername, n.cfg.SMTPPassword, n.cfg.SMTPHost)
+
+	// msg.Status and msg.Summary come straight from the alert payload, so a
+	// CR/LF in either would let the sender inject extra headers (Bcc, a
+	// second To, a different Content-Type) or split the header block from
+	// the body. Strip them before they reach the raw header text.
+	subject := fmt.Sprintf("[%s] %s", stripCRLF(msg.Status), stripCRLF(msg.Summary))
+
+	msgBytes := []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
+		n.cfg.From, strings.Join(n.cfg.To, ","), subject, body))
+
+	return smtp.SendMail(addr, auth, n.cfg.From, n.cfg.To, msgBytes)
+}
+
+// stripCRLF removes carriage returns and newlines so attacker-controlled
+// alert text can't be used to inject extra SMTP headers.
+func stripCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", "")
+}
+
+// buildNotifiers instantiates one Notifier per enabled channel in cfg.
+func buildNotifiers(cfg ChannelsConfig) []Notifier {
+	var notifiers []Notifier
+
+	if cfg.Telegram.Enabled {
+		notifiers = append(notifiers, &TelegramNotifier{
+			template:      cfg.Telegram.Template,
+			groupTemplate: cfg.Telegram.GroupTemplate,
+			timeout:       notifierTimeout(cfg.Telegram),
+		})
+	}
+	if cfg.Slack.Enabled {
+		notifiers = append(notifiers, newSlackNotifier(cfg.Slack))
+	}
+	if cfg.Discord.Enabled {
+		notifiers = append(notifiers, newDiscordNotifier(cfg.Discord))
+	}
+	if cfg.Teams.Enabled {
+		notifiers = append(notifiers, newTeamsNotifier(cfg.Teams))
+	}
+	if cfg.Webhook.Enabled {
+		notifiers = append(notifiers, newGenericWebhookNotifier(cfg.Webhook))
+	}
+	if cfg.Email.Enabled {
+		notifiers = append(notifiers, &EmailNotifier{cfg: cfg.Email, timeout: notifierTimeout(cfg.Email)})
+	}
+
+	return notifiers
+}
+
+// joinErrors collapses a slice of per-recipient errors into one error,
+// or nil if there were none.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("%d delivery error(s): %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// notifierTimeout returns cfg's configured timeout, or the package default
+// when unset.
+func notifierTimeout(cfg ChannelConfig) time.Duration {
+	if cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return defaultNotifierTimeout
+}
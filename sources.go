@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sourceRateLimit and sourceRateWindow bound how many ingests per window a
+// single source may make, so a looping or misconfigured Alertmanager can't
+// hammer the webhook.
+const (
+	sourceRateLimit  = 120
+	sourceRateWindow = time.Minute
+)
+
+func sourceSecretKey(name string) string {
+	return "source:" + name + ":secret"
+}
+
+// newSource mints a random signing secret for name and stores it in Redis.
+// The returned token is shown to the admin exactly once; it isn't
+// recoverable afterwards, only revocable.
+func newSource(ctx context.Context, name string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	if err := rclient.Set(ctx, sourceSecretKey(name), token, 0).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeSource deletes name's signing secret, so every future request for
+// it is rejected until /newsource recreates it.
+func revokeSource(ctx context.Context, name string) error {
+	return rclient.Del(ctx, sourceSecretKey(name)).Err()
+}
+
+// sourceSecret looks up name's signing secret. ok is false, with no error,
+// when the source has never been created or was revoked.
+func sourceSecret(ctx context.Context, name string) (secret string, ok bool, err error) {
+	secret, err = rclient.Get(ctx, sourceSecretKey(name)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// verifySignature reports whether sigHeader ("sha256=<hex>") is the
+// HMAC-SHA256 of body keyed by secret, matching Alertmanager's
+// --web.config.file request signing scheme.
+func verifySignature(secret string, body []byte, sigHeader string) bool {
+	hexSig, ok := strings.CutPrefix(sigHeader, "sha256=")
+	if !ok {
+		return false
+	}
+	want, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(want, mac.Sum(nil))
+}
+
+// allowSource enforces sourceRateLimit per sourceRateWindow for name, using
+// a fixed-window counter in Redis so the limit is shared across replicas.
+func allowSource(ctx context.Context, name string) (bool, error) {
+	window := time.Now().Unix() / int64(sourceRateWindow.Seconds())
+	key := fmt.Sprintf("ratelimit:%s:%d", name, window)
+
+	count, err := rclient.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		rclient.Expire(ctx, key, sourceRateWindow)
+	}
+	return count <= sourceRateLimit, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "topsecret"
+	body := []byte(`{"status":"firing"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		sigHeader string
+		want      bool
+	}{
+		{
+			name:      "valid signature",
+			secret:    secret,
+			body:      body,
+			sigHeader: sign(secret, body),
+			want:      true,
+		},
+		{
+			name:      "wrong secret",
+			secret:    secret,
+			body:      body,
+			sigHeader: sign("othersecret", body),
+			want:      false,
+		},
+		{
+			name:      "tampered body",
+			secret:    secret,
+			body:      []byte(`{"status":"resolved"}`),
+			sigHeader: sign(secret, body),
+			want:      false,
+		},
+		{
+			name:      "missing sha256= prefix",
+			secret:    secret,
+			body:      body,
+			sigHeader: hex.EncodeToString([]byte("not-a-real-sig")),
+			want:      false,
+		},
+		{
+			name:      "non-hex digest",
+			secret:    secret,
+			body:      body,
+			sigHeader: "sha256=not-hex",
+			want:      false,
+		},
+		{
+			name:      "empty header",
+			secret:    secret,
+			body:      body,
+			sigHeader: "",
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifySignature(tt.secret, tt.body, tt.sigHeader); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// severityRank orders severities low to high so filters can express a
+// minimum threshold ("severity>=warning" also matches critical).
+var severityRank = map[string]int{
+	"info":     0,
+	"warning":  1,
+	"critical": 2,
+}
+
+// SubscriberRules is the per-chat routing configuration stored under the
+// Redis hash "sub:<chatID>", except Sources, which lives in the set
+// "sub:<chatID>:sources". Restarts read it straight back from Redis, so it
+// has no other backing store.
+type SubscriberRules struct {
+	ChatID      string
+	MinSeverity string
+	Route       string
+	MuteStart   string
+	MuteEnd     string
+	MuteTZ      string
+	// Sources is the set of source names (see /newsource) this subscriber
+	// restricted themselves to via /subscribe <source>. Empty means every
+	// source, including "default", the one POST / (mainHandler) signs against.
+	Sources []string
+}
+
+func subscriberKey(chatID string) string {
+	return "sub:" + chatID
+}
+
+func subscriberSourcesKey(chatID string) string {
+	return "sub:" + chatID + ":sources"
+}
+
+func loadSubscriberRules(ctx context.Context, chatID string) (SubscriberRules, error) {
+	vals, err := rclient.HGetAll(ctx, subscriberKey(chatID)).Result()
+	if err != nil {
+		return SubscriberRules{}, err
+	}
+	sources, err := rclient.SMembers(ctx, subscriberSourcesKey(chatID)).Result()
+	if err != nil {
+		return SubscriberRules{}, err
+	}
+	return SubscriberRules{
+		ChatID:      chatID,
+		MinSeverity: vals["severity"],
+		Route:       vals["route"],
+		MuteStart:   vals["mute_start"],
+		MuteEnd:     vals["mute_end"],
+		MuteTZ:      vals["mute_tz"],
+		Sources:     sources,
+	}, nil
+}
+
+// Matches reports whether c passes this subscriber's severity, route and
+// source filters. Filters that are unset always pass.
+func (r SubscriberRules) Matches(c MessageComposed) bool {
+	if r.MinSeverity != "" {
+		want, wantOK := severityRank[strings.ToLower(r.MinSeverity)]
+		got, gotOK := severityRank[strings.ToLower(c.Severity)]
+		if wantOK && gotOK && got < want {
+			return false
+		}
+	}
+
+	if r.Route != "" {
+		re, err := regexp.Compile(r.Route)
+		if err != nil || !re.MatchString(c.Summary) {
+			return false
+		}
+	}
+
+	if len(r.Sources) > 0 && !slices.Contains(r.Sources, c.Source) {
+		return false
+	}
+
+	return true
+}
+
+// Muted reports whether now falls inside this subscriber's quiet hours.
+func (r SubscriberRules) Muted(now time.Time) bool {
+	if r.MuteStart == "" || r.MuteEnd == "" {
+		return false
+	}
+
+	loc, err := time.LoadLocation(r.MuteTZ)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	start, errStart := time.Parse("15:04", r.MuteStart)
+	end, errEnd := time.Parse("15:04", r.MuteEnd)
+	if errStart != nil || errEnd != nil {
+		return false
+	}
+
+	localNow := now.In(loc)
+	nowMinutes := localNow.Hour()*60 + localNow.Minute()
+	startMinutes := start.Hour()*60 + start.Minute()
+	endMinutes := end.Hour()*60 + end.Minute()
+
+	if startMinutes <= endMinutes {
+		return nowMinutes >= startMinutes && nowMinutes < endMinutes
+	}
+	// The window wraps past midnight, e.g. 22:00-08:00.
+	return nowMinutes >= startMinutes || nowMinutes < endMinutes
+}
+
+// subscribeChat adds chatID to the subscriber list. When source is empty
+// the subscriber keeps receiving every source, as before; a non-empty
+// source restricts (and adds to) the set of sources they accept, so
+// repeated "/subscribe <source>" calls build up a source allow-list.
+func subscribeChat(ctx context.Context, chatID, source string) error {
+	if err := rclient.SAdd(ctx, "subscribers", chatID).Err(); err != nil {
+		return err
+	}
+	if source == "" {
+		return nil
+	}
+	return rclient.SAdd(ctx, subscriberSourcesKey(chatID), source).Err()
+}
+
+func unsubscribeChat(ctx context.Context, chatID string) error {
+	if err := rclient.SRem(ctx, "subscribers", chatID).Err(); err != nil {
+		return err
+	}
+	if err := rclient.Del(ctx, subscriberSourcesKey(chatID)).Err(); err != nil {
+		return err
+	}
+	return rclient.Del(ctx, subscriberKey(chatID)).Err()
+}
+
+var filterPattern = regexp.MustCompile(`^severity>=(info|warning|critical)$`)
+
+// setFilter parses and stores a "/filter severity>=warning" matcher.
+func setFilter(ctx context.Context, chatID, matcher string) error {
+	m := filterPattern.FindStringSubmatch(matcher)
+	if m == nil {
+		return fmt.Errorf("invalid filter %q, expected severity>=info|warning|critical", matcher)
+	}
+	return rclient.HSet(ctx, subscriberKey(chatID), "severity", m[1]).Err()
+}
+
+// setRoute parses and stores a "/route <regex>" summary matcher.
+func setRoute(ctx context.Context, chatID, pattern string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid route regex %q: %w", pattern, err)
+	}
+	return rclient.HSet(ctx, subscriberKey(chatID), "route", pattern).Err()
+}
+
+var mutePattern = regexp.MustCompile(`^(\d{2}:\d{2})-(\d{2}:\d{2})\s+(\S+)$`)
+
+// setMute parses and stores a "/mute 22:00-08:00 Europe/Berlin" window.
+func setMute(ctx context.Context, chatID, schedule string) error {
+	m := mutePattern.FindStringSubmatch(strings.TrimSpace(schedule))
+	if m == nil {
+		return fmt.Errorf("invalid mute schedule %q, expected HH:MM-HH:MM Area/City", schedule)
+	}
+
+	start, end, tz := m[1], m[2], m[3]
+	if _, err := time.Parse("15:04", start); err != nil {
+		return fmt.Errorf("invalid mute start %q: %w", start, err)
+	}
+	if _, err := time.Parse("15:04", end); err != nil {
+		return fmt.Errorf("invalid mute end %q: %w", end, err)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+
+	return rclient.HSet(ctx, subscriberKey(chatID),
+		"mute_start", start,
+		"mute_end", end,
+		"mute_tz", tz,
+	).Err()
+}
+
+func statusFor(ctx context.Context, chatID string) (string, error) {
+	rules, err := loadSubscriberRules(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	severityFilter := rules.MinSeverity
+	if severityFilter == "" {
+		severityFilter = "any"
+	}
+	route := rules.Route
+	if route == "" {
+		route = "any"
+	}
+	mute := "none"
+	if rules.MuteStart != "" {
+		mute = fmt.Sprintf("%s-%s %s", rules.MuteStart, rules.MuteEnd, rules.MuteTZ)
+	}
+	sources := "any"
+	if len(rules.Sources) > 0 {
+		sources = strings.Join(rules.Sources, ", ")
+	}
+
+	return fmt.Sprintf("severity>=%s\nroute: %s\nmute: %s\nsources: %s", severityFilter, route, mute, sources), nil
+}
+
+// sampleAlert is what /test sends so a subscriber can see what a real alert
+// will look like without waiting for one to fire.
+var sampleAlert = MessageComposed{
+	Severity:     "Warning",
+	SeverityIcon: severity["warning"],
+	Status:       "firing",
+	Summary:      "This is a test alert",
+	Description:  "Sent in response to /test, no action needed.",
+	GeneratorURL: "",
+}
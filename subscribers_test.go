@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriberRulesMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules SubscriberRules
+		alert MessageComposed
+		want  bool
+	}{
+		{
+			name:  "no filters matches anything",
+			rules: SubscriberRules{},
+			alert: MessageComposed{Severity: "info", Summary: "disk full", Source: "prod"},
+			want:  true,
+		},
+		{
+			name:  "severity at minimum passes",
+			rules: SubscriberRules{MinSeverity: "warning"},
+			alert: MessageComposed{Severity: "warning"},
+			want:  true,
+		},
+		{
+			name:  "severity above minimum passes",
+			rules: SubscriberRules{MinSeverity: "warning"},
+			alert: MessageComposed{Severity: "critical"},
+			want:  true,
+		},
+		{
+			name:  "severity below minimum fails",
+			rules: SubscriberRules{MinSeverity: "warning"},
+			alert: MessageComposed{Severity: "info"},
+			want:  false,
+		},
+		{
+			name:  "route regex matches summary",
+			rules: SubscriberRules{Route: "^disk"},
+			alert: MessageComposed{Summary: "disk full on /var"},
+			want:  true,
+		},
+		{
+			name:  "route regex does not match summary",
+			rules: SubscriberRules{Route: "^disk"},
+			alert: MessageComposed{Summary: "cpu spike"},
+			want:  false,
+		},
+		{
+			name:  "invalid route regex never matches",
+			rules: SubscriberRules{Route: "("},
+			alert: MessageComposed{Summary: "anything"},
+			want:  false,
+		},
+		{
+			name:  "source allow-list includes source",
+			rules: SubscriberRules{Sources: []string{"prod", "staging"}},
+			alert: MessageComposed{Source: "staging"},
+			want:  true,
+		},
+		{
+			name:  "source allow-list excludes source",
+			rules: SubscriberRules{Sources: []string{"prod"}},
+			alert: MessageComposed{Source: "staging"},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Matches(tt.alert); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriberRulesMuted(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules SubscriberRules
+		now   time.Time
+		want  bool
+	}{
+		{
+			name:  "no mute window configured",
+			rules: SubscriberRules{},
+			now:   time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC),
+			want:  false,
+		},
+		{
+			name:  "inside a same-day window",
+			rules: SubscriberRules{MuteStart: "09:00", MuteEnd: "17:00", MuteTZ: "UTC"},
+			now:   time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+			want:  true,
+		},
+		{
+			name:  "outside a same-day window",
+			rules: SubscriberRules{MuteStart: "09:00", MuteEnd: "17:00", MuteTZ: "UTC"},
+			now:   time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC),
+			want:  false,
+		},
+		{
+			name:  "inside a midnight-wrapping window, before midnight",
+			rules: SubscriberRules{MuteStart: "22:00", MuteEnd: "08:00", MuteTZ: "UTC"},
+			now:   time.Date(2026, 1, 1, 23, 30, 0, 0, time.UTC),
+			want:  true,
+		},
+		{
+			name:  "inside a midnight-wrapping window, after midnight",
+			rules: SubscriberRules{MuteStart: "22:00", MuteEnd: "08:00", MuteTZ: "UTC"},
+			now:   time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC),
+			want:  true,
+		},
+		{
+			name:  "outside a midnight-wrapping window",
+			rules: SubscriberRules{MuteStart: "22:00", MuteEnd: "08:00", MuteTZ: "UTC"},
+			now:   time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+			want:  false,
+		},
+		{
+			name:  "invalid timezone falls back to UTC instead of erroring",
+			rules: SubscriberRules{MuteStart: "09:00", MuteEnd: "17:00", MuteTZ: "Not/AZone"},
+			now:   time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Muted(tt.now); got != tt.want {
+				t.Errorf("Muted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}